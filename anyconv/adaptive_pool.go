@@ -0,0 +1,376 @@
+package anyconv
+
+import (
+	"sync"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	var a AdaptiveAvgPool2D
+	serializer.RegisterTypedDeserializer(a.SerializerType(), DeserializeAdaptiveAvgPool2D)
+	var m AdaptiveMaxPool2D
+	serializer.RegisterTypedDeserializer(m.SerializerType(), DeserializeAdaptiveMaxPool2D)
+}
+
+// adaptiveSpan computes the [start, end) range of the
+// input dimension that output index i pools over, given
+// inSize input cells mapped onto outSize output cells.
+func adaptiveSpan(i, outSize, inSize int) (start, end int) {
+	start = i * inSize / outSize
+	end = ((i+1)*inSize + outSize - 1) / outSize
+	return
+}
+
+// AdaptiveAvgPool2D is an average-pooling layer that pools
+// its input down to a fixed output size, regardless of the
+// input's spatial dimensions.
+//
+// Unlike AvgPool, the span and stride of each pool cell are
+// computed automatically from InputWidth/InputHeight and
+// OutputWidth/OutputHeight, so a single AdaptiveAvgPool2D
+// can be used in the same network graph for inputs of
+// varying size: simply update InputWidth and InputHeight
+// before calling Apply.
+type AdaptiveAvgPool2D struct {
+	OutputWidth  int
+	OutputHeight int
+
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+
+	im2colLock sync.Mutex
+	cachedW    int
+	cachedH    int
+	im2col     anyvec.Mapper
+	sumMapper  anyvec.Mapper
+	invCounts  anyvec.Vector
+}
+
+// DeserializeAdaptiveAvgPool2D deserializes an AdaptiveAvgPool2D.
+func DeserializeAdaptiveAvgPool2D(d []byte) (*AdaptiveAvgPool2D, error) {
+	var oW, oH, iW, iH, iD serializer.Int
+	err := serializer.DeserializeAny(d, &oW, &oH, &iW, &iH, &iD)
+	if err != nil {
+		return nil, essentials.AddCtx("deserialize AdaptiveAvgPool2D", err)
+	}
+	return &AdaptiveAvgPool2D{
+		OutputWidth:  int(oW),
+		OutputHeight: int(oH),
+		InputWidth:   int(iW),
+		InputHeight:  int(iH),
+		InputDepth:   int(iD),
+	}, nil
+}
+
+// OutputDepth returns the depth of the output tensor.
+func (a *AdaptiveAvgPool2D) OutputDepth() int {
+	return a.InputDepth
+}
+
+// Apply applies the layer to an input tensor.
+func (a *AdaptiveAvgPool2D) Apply(in anydiff.Res, batchSize int) anydiff.Res {
+	a.im2colLock.Lock()
+	if a.im2col == nil || a.cachedW != a.InputWidth || a.cachedH != a.InputHeight {
+		a.initIm2Col(in.Output().Creator())
+	}
+	a.im2colLock.Unlock()
+
+	imgSize := a.InputWidth * a.InputHeight * a.InputDepth
+	if in.Output().Len() != batchSize*imgSize {
+		panic("incorrect input size")
+	}
+
+	im2ColTemp := in.Output().Creator().MakeVector(a.im2col.OutSize())
+
+	var avgResults []anyvec.Vector
+	for i := 0; i < batchSize; i++ {
+		subIn := in.Output().Slice(imgSize*i, imgSize*(i+1))
+		a.im2col.Map(subIn, im2ColTemp)
+		sums := in.Output().Creator().MakeVector(a.sumMapper.InSize())
+		a.sumMapper.MapTranspose(im2ColTemp, sums)
+		sums.Mul(a.invCounts)
+		avgResults = append(avgResults, sums)
+	}
+
+	return &adaptiveAvgPoolRes{
+		Layer:  a,
+		In:     in,
+		OutVec: in.Output().Creator().Concat(avgResults...),
+	}
+}
+
+// SerializerType returns the unique ID used to serialize
+// an AdaptiveAvgPool2D with the serializer package.
+func (a *AdaptiveAvgPool2D) SerializerType() string {
+	return "github.com/unixpickle/anynet/anyconv.AdaptiveAvgPool2D"
+}
+
+// Serialize serializes the AdaptiveAvgPool2D.
+func (a *AdaptiveAvgPool2D) Serialize() ([]byte, error) {
+	return serializer.SerializeAny(
+		serializer.Int(a.OutputWidth),
+		serializer.Int(a.OutputHeight),
+		serializer.Int(a.InputWidth),
+		serializer.Int(a.InputHeight),
+		serializer.Int(a.InputDepth),
+	)
+}
+
+func (a *AdaptiveAvgPool2D) initIm2Col(cr anyvec.Creator) {
+	mapping, groupMapping, counts := adaptivePoolMapping(a.OutputWidth, a.OutputHeight,
+		a.InputWidth, a.InputHeight, a.InputDepth)
+
+	inSize := a.InputWidth * a.InputHeight * a.InputDepth
+	a.im2col = cr.MakeMapper(inSize, mapping)
+
+	numGroups := a.OutputWidth * a.OutputHeight * a.InputDepth
+	a.sumMapper = cr.MakeMapper(numGroups, groupMapping)
+
+	invCounts := make([]float64, numGroups)
+	for i, c := range counts {
+		invCounts[i] = 1 / float64(c)
+	}
+	a.invCounts = cr.MakeVectorData(cr.MakeNumericList(invCounts))
+
+	a.cachedW = a.InputWidth
+	a.cachedH = a.InputHeight
+}
+
+// adaptivePoolMapping builds the im2col mapping (one entry
+// per (output cell, depth, sub-position) triple, ordered
+// with sub-positions contiguous within a group), the
+// groupMapping used to sum a group down to a single value
+// via anyvec.Mapper.MapTranspose, and the per-group element
+// counts (needed since adaptive pool cells don't all have
+// the same size).
+func adaptivePoolMapping(outW, outH, inW, inH, depth int) (mapping, groupMapping []int, counts []int) {
+	group := 0
+	for oy := 0; oy < outH; oy++ {
+		startY, endY := adaptiveSpan(oy, outH, inH)
+		for ox := 0; ox < outW; ox++ {
+			startX, endX := adaptiveSpan(ox, outW, inW)
+			for z := 0; z < depth; z++ {
+				count := 0
+				for y := startY; y < endY; y++ {
+					rowIdx := y * inW * depth
+					for x := startX; x < endX; x++ {
+						mapping = append(mapping, rowIdx+x*depth+z)
+						groupMapping = append(groupMapping, group)
+						count++
+					}
+				}
+				counts = append(counts, count)
+				group++
+			}
+		}
+	}
+	return
+}
+
+type adaptiveAvgPoolRes struct {
+	Layer  *AdaptiveAvgPool2D
+	In     anydiff.Res
+	OutVec anyvec.Vector
+}
+
+func (a *adaptiveAvgPoolRes) Output() anyvec.Vector {
+	return a.OutVec
+}
+
+func (a *adaptiveAvgPoolRes) Vars() anydiff.VarSet {
+	return a.In.Vars()
+}
+
+func (a *adaptiveAvgPoolRes) Propagate(u anyvec.Vector, g anydiff.Grad) {
+	outSize := a.Layer.sumMapper.InSize()
+	batchSize := u.Len() / outSize
+
+	var upPieces []anyvec.Vector
+	for i := 0; i < batchSize; i++ {
+		upSlice := u.Slice(outSize*i, outSize*(i+1)).Copy()
+		upSlice.Mul(a.Layer.invCounts)
+		spread := u.Creator().MakeVector(a.Layer.sumMapper.OutSize())
+		a.Layer.sumMapper.Map(upSlice, spread)
+		upPiece := u.Creator().MakeVector(a.Layer.im2col.InSize())
+		a.Layer.im2col.MapTranspose(spread, upPiece)
+		upPieces = append(upPieces, upPiece)
+	}
+	upstream := u.Creator().Concat(upPieces...)
+	a.In.Propagate(upstream, g)
+}
+
+// AdaptiveMaxPool2D is a max-pooling layer that pools its
+// input down to a fixed output size, regardless of the
+// input's spatial dimensions.
+//
+// It behaves like AdaptiveAvgPool2D, except that each pool
+// cell's output is the max of its inputs rather than the
+// mean. Since anyvec.MapMax requires every pool to have the
+// same number of cells, incomplete pools (which occur when
+// InputWidth/InputHeight don't evenly divide OutputWidth/
+// OutputHeight) are padded by repeating their last index;
+// repeating an index can never change the max, and gradient
+// is always routed to the single winning index.
+type AdaptiveMaxPool2D struct {
+	OutputWidth  int
+	OutputHeight int
+
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+
+	im2colLock sync.Mutex
+	cachedW    int
+	cachedH    int
+	im2col     anyvec.Mapper
+	groupSize  int
+}
+
+// DeserializeAdaptiveMaxPool2D deserializes an AdaptiveMaxPool2D.
+func DeserializeAdaptiveMaxPool2D(d []byte) (*AdaptiveMaxPool2D, error) {
+	var oW, oH, iW, iH, iD serializer.Int
+	err := serializer.DeserializeAny(d, &oW, &oH, &iW, &iH, &iD)
+	if err != nil {
+		return nil, essentials.AddCtx("deserialize AdaptiveMaxPool2D", err)
+	}
+	return &AdaptiveMaxPool2D{
+		OutputWidth:  int(oW),
+		OutputHeight: int(oH),
+		InputWidth:   int(iW),
+		InputHeight:  int(iH),
+		InputDepth:   int(iD),
+	}, nil
+}
+
+// OutputDepth returns the depth of the output tensor.
+func (a *AdaptiveMaxPool2D) OutputDepth() int {
+	return a.InputDepth
+}
+
+// Apply applies the layer to an input tensor.
+func (a *AdaptiveMaxPool2D) Apply(in anydiff.Res, batchSize int) anydiff.Res {
+	a.im2colLock.Lock()
+	if a.im2col == nil || a.cachedW != a.InputWidth || a.cachedH != a.InputHeight {
+		a.initIm2Col(in.Output().Creator())
+	}
+	a.im2colLock.Unlock()
+
+	imgSize := a.InputWidth * a.InputHeight * a.InputDepth
+	if in.Output().Len() != batchSize*imgSize {
+		panic("incorrect input size")
+	}
+
+	im2ColTemp := in.Output().Creator().MakeVector(a.im2col.OutSize())
+
+	var maxResults []anyvec.Vector
+	var maxMaps []anyvec.Mapper
+	for i := 0; i < batchSize; i++ {
+		subIn := in.Output().Slice(imgSize*i, imgSize*(i+1))
+		a.im2col.Map(subIn, im2ColTemp)
+		mapping := anyvec.MapMax(im2ColTemp, a.groupSize)
+		output := in.Output().Creator().MakeVector(mapping.OutSize())
+		mapping.Map(im2ColTemp, output)
+		maxMaps = append(maxMaps, mapping)
+		maxResults = append(maxResults, output)
+	}
+
+	return &adaptiveMaxPoolRes{
+		Layer:  a,
+		In:     in,
+		OutVec: in.Output().Creator().Concat(maxResults...),
+		Maps:   maxMaps,
+	}
+}
+
+// SerializerType returns the unique ID used to serialize
+// an AdaptiveMaxPool2D with the serializer package.
+func (a *AdaptiveMaxPool2D) SerializerType() string {
+	return "github.com/unixpickle/anynet/anyconv.AdaptiveMaxPool2D"
+}
+
+// Serialize serializes the AdaptiveMaxPool2D.
+func (a *AdaptiveMaxPool2D) Serialize() ([]byte, error) {
+	return serializer.SerializeAny(
+		serializer.Int(a.OutputWidth),
+		serializer.Int(a.OutputHeight),
+		serializer.Int(a.InputWidth),
+		serializer.Int(a.InputHeight),
+		serializer.Int(a.InputDepth),
+	)
+}
+
+func (a *AdaptiveMaxPool2D) initIm2Col(cr anyvec.Creator) {
+	mapping, groupSize := adaptiveMaxPoolMapping(a.OutputWidth, a.OutputHeight,
+		a.InputWidth, a.InputHeight, a.InputDepth)
+
+	inSize := a.InputWidth * a.InputHeight * a.InputDepth
+	a.im2col = cr.MakeMapper(inSize, mapping)
+	a.groupSize = groupSize
+
+	a.cachedW = a.InputWidth
+	a.cachedH = a.InputHeight
+}
+
+// adaptiveMaxPoolMapping is like adaptivePoolMapping, but
+// pads every group up to the largest group size by
+// repeating its last index, so anyvec.MapMax (which only
+// supports a single uniform group size) can be used.
+func adaptiveMaxPoolMapping(outW, outH, inW, inH, depth int) (mapping []int, groupSize int) {
+	rawMapping, groupMapping, counts := adaptivePoolMapping(outW, outH, inW, inH, depth)
+	for _, c := range counts {
+		if c > groupSize {
+			groupSize = c
+		}
+	}
+
+	numGroups := outW * outH * depth
+	mapping = make([]int, 0, numGroups*groupSize)
+	idx := 0
+	for g := 0; g < numGroups; g++ {
+		start := idx
+		for idx < len(groupMapping) && groupMapping[idx] == g {
+			idx++
+		}
+		group := rawMapping[start:idx]
+		mapping = append(mapping, group...)
+		for len(mapping)%groupSize != 0 {
+			mapping = append(mapping, group[len(group)-1])
+		}
+	}
+	return
+}
+
+type adaptiveMaxPoolRes struct {
+	Layer  *AdaptiveMaxPool2D
+	In     anydiff.Res
+	OutVec anyvec.Vector
+	Maps   []anyvec.Mapper
+}
+
+func (a *adaptiveMaxPoolRes) Output() anyvec.Vector {
+	return a.OutVec
+}
+
+func (a *adaptiveMaxPoolRes) Vars() anydiff.VarSet {
+	return a.In.Vars()
+}
+
+func (a *adaptiveMaxPoolRes) Propagate(u anyvec.Vector, g anydiff.Grad) {
+	outSize := u.Len() / len(a.Maps)
+	var upPieces []anyvec.Vector
+	for i, mapper := range a.Maps {
+		upSlice := u.Slice(outSize*i, outSize*(i+1))
+		permed := u.Creator().MakeVector(mapper.InSize())
+		mapper.MapTranspose(upSlice, permed)
+		upPiece := u.Creator().MakeVector(a.Layer.im2col.InSize())
+		a.Layer.im2col.MapTranspose(permed, upPiece)
+		upPieces = append(upPieces, upPiece)
+	}
+	upstream := u.Creator().Concat(upPieces...)
+	a.In.Propagate(upstream, g)
+}
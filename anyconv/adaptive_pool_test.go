@@ -0,0 +1,50 @@
+package anyconv
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// TestAdaptivePoolUnevenDivision checks both adaptive pools
+// against hand-computed values when OutputWidth doesn't evenly
+// divide InputWidth, so neighboring pool cells overlap (the
+// case adaptiveSpan exists for). Both cells here hold three
+// values, so the pools are all the same size.
+func TestAdaptivePoolUnevenDivision(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	in := c.MakeVectorData(c.MakeNumericList([]float64{1, 2, 3, 4, 5}))
+
+	// adaptiveSpan(0, 2, 5) = [0, 3), adaptiveSpan(1, 2, 5) = [2, 5),
+	// so the two (overlapping) pool cells are {1,2,3} and {3,4,5}.
+	avg := &AdaptiveAvgPool2D{
+		OutputWidth:  2,
+		OutputHeight: 1,
+		InputWidth:   5,
+		InputHeight:  1,
+		InputDepth:   1,
+	}
+	avgOut := avg.Apply(anydiff.NewVar(in), 1).Output().Data().([]float32)
+	expectedAvg := []float32{2, 4}
+	for i, x := range expectedAvg {
+		if avgOut[i] != x {
+			t.Errorf("avg pool %d: expected %v got %v", i, x, avgOut[i])
+		}
+	}
+
+	max := &AdaptiveMaxPool2D{
+		OutputWidth:  2,
+		OutputHeight: 1,
+		InputWidth:   5,
+		InputHeight:  1,
+		InputDepth:   1,
+	}
+	maxOut := max.Apply(anydiff.NewVar(in), 1).Output().Data().([]float32)
+	expectedMax := []float32{3, 5}
+	for i, x := range expectedMax {
+		if maxOut[i] != x {
+			t.Errorf("max pool %d: expected %v got %v", i, x, maxOut[i])
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package anyconv
+
+import (
+	"sync"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	var a AvgPool
+	serializer.RegisterTypedDeserializer(a.SerializerType(), DeserializeAvgPool)
+}
+
+// AvgPool is an average-pooling layer.
+//
+// All input and output tensors are row-major depth-minor.
+//
+// If the span along a dimension doesn't divide the
+// corresponding input dimension, then any input values in
+// an "incomplete" pool are ignored.
+//
+// Unlike MaxPool, the upstream gradient is spread equally
+// across every cell in a pool, rather than being routed to
+// a single argmax cell.
+type AvgPool struct {
+	// Span is equivalent to a convolutional layer's filter
+	// size.
+	SpanX int
+	SpanY int
+
+	// Stride is equivalent to a convolutional layer's
+	// stride.
+	StrideX int
+	StrideY int
+
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+
+	im2colLock sync.Mutex
+	im2col     anyvec.Mapper
+	sumMapper  anyvec.Mapper
+}
+
+// DeserializeAvgPool deserializes an AvgPool.
+func DeserializeAvgPool(d []byte) (*AvgPool, error) {
+	var sX, sY, iW, iH, iD, strideX, strideY serializer.Int
+	err := serializer.DeserializeAny(d, &sX, &sY, &iW, &iH, &iD, &strideX, &strideY)
+	if err != nil {
+		return nil, essentials.AddCtx("deserialize AvgPool", err)
+	}
+	return &AvgPool{
+		SpanX:       int(sX),
+		SpanY:       int(sY),
+		StrideX:     int(strideX),
+		StrideY:     int(strideY),
+		InputWidth:  int(iW),
+		InputHeight: int(iH),
+		InputDepth:  int(iD),
+	}, nil
+}
+
+// OutputWidth returns the width of the output tensor.
+func (a *AvgPool) OutputWidth() int {
+	return a.surrogateConv().OutputWidth()
+}
+
+// OutputHeight returns the height of the output tensor.
+func (a *AvgPool) OutputHeight() int {
+	return a.surrogateConv().OutputHeight()
+}
+
+// OutputDepth returns the depth of the output tensor.
+func (a *AvgPool) OutputDepth() int {
+	return a.InputDepth
+}
+
+// Apply applies the layer to an input tensor.
+func (a *AvgPool) Apply(in anydiff.Res, batchSize int) anydiff.Res {
+	a.im2colLock.Lock()
+	if a.im2col == nil {
+		a.initIm2Col(in.Output().Creator())
+	}
+	a.im2colLock.Unlock()
+
+	imgSize := a.InputWidth * a.InputHeight * a.InputDepth
+	if in.Output().Len() != batchSize*imgSize {
+		panic("incorrect input size")
+	}
+
+	groupSize := a.SpanX * a.SpanY
+	scaler := in.Output().Creator().MakeNumeric(1 / float64(groupSize))
+
+	im2ColTemp := in.Output().Creator().MakeVector(a.im2col.OutSize())
+
+	var avgResults []anyvec.Vector
+	for i := 0; i < batchSize; i++ {
+		subIn := in.Output().Slice(imgSize*i, imgSize*(i+1))
+		a.im2col.Map(subIn, im2ColTemp)
+		sums := in.Output().Creator().MakeVector(a.sumMapper.InSize())
+		a.sumMapper.MapTranspose(im2ColTemp, sums)
+		sums.Scale(scaler)
+		avgResults = append(avgResults, sums)
+	}
+
+	return &avgPoolRes{
+		Layer:  a,
+		In:     in,
+		OutVec: in.Output().Creator().Concat(avgResults...),
+	}
+}
+
+// SerializerType returns the unique ID used to serialize
+// an AvgPool with the serializer package.
+func (a *AvgPool) SerializerType() string {
+	return "github.com/unixpickle/anynet/anyconv.AvgPool"
+}
+
+// Serialize serializes the AvgPool.
+func (a *AvgPool) Serialize() ([]byte, error) {
+	return serializer.SerializeAny(
+		serializer.Int(a.SpanX),
+		serializer.Int(a.SpanY),
+		serializer.Int(a.InputWidth),
+		serializer.Int(a.InputHeight),
+		serializer.Int(a.InputDepth),
+		serializer.Int(a.StrideX),
+		serializer.Int(a.StrideY),
+	)
+}
+
+func (a *AvgPool) initIm2Col(cr anyvec.Creator) {
+	mapping, groupSize := a.mappingData()
+
+	inSize := a.InputWidth * a.InputHeight * a.InputDepth
+	a.im2col = cr.MakeMapper(inSize, mapping)
+
+	numGroups := len(mapping) / groupSize
+	groupMapping := make([]int, len(mapping))
+	for i := range groupMapping {
+		groupMapping[i] = i / groupSize
+	}
+	a.sumMapper = cr.MakeMapper(numGroups, groupMapping)
+}
+
+// mappingData computes the im2col mapping without requiring
+// an anyvec.Creator, so it can be shared between initIm2Col
+// and code generation.
+func (a *AvgPool) mappingData() (mapping []int, groupSize int) {
+	groupSize = a.SpanX * a.SpanY
+
+	for y := 0; y+a.SpanY <= a.InputHeight; y += a.StrideY {
+		for x := 0; x+a.SpanX <= a.InputWidth; x += a.StrideX {
+			for subZ := 0; subZ < a.InputDepth; subZ++ {
+				for subY := 0; subY < a.SpanY; subY++ {
+					subYIdx := (y + subY) * a.InputWidth * a.InputDepth
+					for subX := 0; subX < a.SpanX; subX++ {
+						subXIdx := subYIdx + (subX+x)*a.InputDepth
+						mapping = append(mapping, subXIdx+subZ)
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func (a *AvgPool) surrogateConv() *Conv {
+	return &Conv{
+		FilterCount:  a.InputDepth,
+		FilterWidth:  a.SpanX,
+		FilterHeight: a.SpanY,
+		StrideX:      a.StrideX,
+		StrideY:      a.StrideY,
+		InputWidth:   a.InputWidth,
+		InputHeight:  a.InputHeight,
+		InputDepth:   a.InputDepth,
+	}
+}
+
+type avgPoolRes struct {
+	Layer  *AvgPool
+	In     anydiff.Res
+	OutVec anyvec.Vector
+}
+
+func (a *avgPoolRes) Output() anyvec.Vector {
+	return a.OutVec
+}
+
+func (a *avgPoolRes) Vars() anydiff.VarSet {
+	return a.In.Vars()
+}
+
+func (a *avgPoolRes) Propagate(u anyvec.Vector, g anydiff.Grad) {
+	groupSize := a.Layer.SpanX * a.Layer.SpanY
+	scaler := u.Creator().MakeNumeric(1 / float64(groupSize))
+	outSize := a.Layer.sumMapper.InSize()
+	batchSize := u.Len() / outSize
+
+	var upPieces []anyvec.Vector
+	for i := 0; i < batchSize; i++ {
+		upSlice := u.Slice(outSize*i, outSize*(i+1))
+		spread := u.Creator().MakeVector(a.Layer.sumMapper.OutSize())
+		a.Layer.sumMapper.Map(upSlice, spread)
+		spread.Scale(scaler)
+		upPiece := u.Creator().MakeVector(a.Layer.im2col.InSize())
+		a.Layer.im2col.MapTranspose(spread, upPiece)
+		upPieces = append(upPieces, upPiece)
+	}
+	upstream := u.Creator().Concat(upPieces...)
+	a.In.Propagate(upstream, g)
+}
@@ -0,0 +1,70 @@
+package anyconv
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anydiff/anydifftest"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// TestAvgPoolForward checks Apply against a hand-computed
+// average over non-overlapping 2x2 pools.
+func TestAvgPoolForward(t *testing.T) {
+	layer := &AvgPool{
+		SpanX:       2,
+		SpanY:       2,
+		StrideX:     2,
+		StrideY:     2,
+		InputWidth:  4,
+		InputHeight: 4,
+		InputDepth:  1,
+	}
+
+	c := anyvec32.CurrentCreator()
+	in := c.MakeVectorData(c.MakeNumericList([]float64{
+		1, 2, 3, 4,
+		5, 6, 7, 8,
+		9, 10, 11, 12,
+		13, 14, 15, 16,
+	}))
+
+	out := layer.Apply(anydiff.NewVar(in), 1).Output().Data().([]float32)
+	expected := []float32{3.5, 5.5, 11.5, 13.5}
+	for i, x := range expected {
+		if out[i] != x {
+			t.Errorf("output %d: expected %v got %v", i, x, out[i])
+		}
+	}
+}
+
+// TestAvgPoolPropagate finite-difference checks Propagate's
+// uniform gradient spread.
+func TestAvgPoolPropagate(t *testing.T) {
+	layer := &AvgPool{
+		SpanX:       2,
+		SpanY:       2,
+		StrideX:     2,
+		StrideY:     2,
+		InputWidth:  4,
+		InputHeight: 4,
+		InputDepth:  1,
+	}
+
+	c := anyvec32.CurrentCreator()
+	in := c.MakeVectorData(c.MakeNumericList([]float64{
+		0.3, -0.5, 1.2, 0.1,
+		-0.2, 0.4, 0.7, -1.1,
+		0.05, 0.9, -0.3, 0.6,
+		-0.8, 0.2, 1.5, -0.4,
+	}))
+	inVar := anydiff.NewVar(in)
+
+	checker := &anydifftest.ResChecker{
+		F: func() anydiff.Res {
+			return layer.Apply(inVar, 1)
+		},
+		V: []*anydiff.Var{inVar},
+	}
+	checker.FullCheck(t)
+}
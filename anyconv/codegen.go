@@ -0,0 +1,70 @@
+package anyconv
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/unixpickle/anynet/anygen"
+)
+
+// EmitForward implements anygen.Codegen.
+//
+// Since MaxPool's im2col mapping and padding fill value
+// don't depend on a trained model's weights, they are
+// folded into the generated source as constants rather than
+// recomputed at inference time.
+func (m *MaxPool) EmitForward(ctx *anygen.Ctx, inVar, outVar string) error {
+	mapping, _, usesSentinel, fillValue := m.mappingData()
+	groupSize := m.SpanX * m.SpanY
+	numGroups := len(mapping) / groupSize
+	mapVar := ctx.ConstInts(mapping)
+
+	src := inVar
+	if usesSentinel {
+		src = ctx.TempVar()
+		fmt.Fprintf(&ctx.Body, "\t%s := append(append([]float32{}, %s...), %s)\n",
+			src, inVar, floatLiteral(ctx, fillValue))
+	}
+
+	fmt.Fprintf(&ctx.Body, "\t%s := make([]float32, %d)\n", outVar, numGroups)
+	fmt.Fprintf(&ctx.Body, "\tfor i := range %s {\n", outVar)
+	fmt.Fprintf(&ctx.Body, "\t\tmax := %s[%s[i*%d]]\n", src, mapVar, groupSize)
+	fmt.Fprintf(&ctx.Body, "\t\tfor j := 1; j < %d; j++ {\n", groupSize)
+	fmt.Fprintf(&ctx.Body, "\t\t\tif v := %s[%s[i*%d+j]]; v > max {\n", src, mapVar, groupSize)
+	fmt.Fprintf(&ctx.Body, "\t\t\t\tmax = v\n\t\t\t}\n\t\t}\n")
+	fmt.Fprintf(&ctx.Body, "\t\t%s[i] = max\n\t}\n", outVar)
+	return nil
+}
+
+// EmitForward implements anygen.Codegen.
+//
+// Like MaxPool's, AvgPool's im2col mapping is folded into
+// the generated source as a constant.
+func (a *AvgPool) EmitForward(ctx *anygen.Ctx, inVar, outVar string) error {
+	mapping, groupSize := a.mappingData()
+	numGroups := len(mapping) / groupSize
+	mapVar := ctx.ConstInts(mapping)
+
+	fmt.Fprintf(&ctx.Body, "\t%s := make([]float32, %d)\n", outVar, numGroups)
+	fmt.Fprintf(&ctx.Body, "\tfor i := range %s {\n", outVar)
+	fmt.Fprintf(&ctx.Body, "\t\tvar sum float32\n")
+	fmt.Fprintf(&ctx.Body, "\t\tfor j := 0; j < %d; j++ {\n", groupSize)
+	fmt.Fprintf(&ctx.Body, "\t\t\tsum += %s[%s[i*%d+j]]\n\t\t}\n", inVar, mapVar, groupSize)
+	fmt.Fprintf(&ctx.Body, "\t\t%s[i] = sum / %v\n\t}\n", outVar, float32(groupSize))
+	return nil
+}
+
+// floatLiteral returns a Go expression of type float32 for
+// v. Infinities have no literal syntax, so they're emitted
+// as a call to math.Inf, which requires importing "math" in
+// the generated source.
+func floatLiteral(ctx *anygen.Ctx, v float64) string {
+	if math.IsInf(v, 0) {
+		ctx.AddImport("math")
+		if v < 0 {
+			return "float32(math.Inf(-1))"
+		}
+		return "float32(math.Inf(1))"
+	}
+	return fmt.Sprintf("float32(%v)", v)
+}
@@ -1,6 +1,7 @@
 package anyconv
 
 import (
+	"math"
 	"sync"
 
 	"github.com/unixpickle/anydiff"
@@ -14,13 +15,46 @@ func init() {
 	serializer.RegisterTypedDeserializer(m.SerializerType(), DeserializeMaxPool)
 }
 
+// A PadMode specifies how (and whether) a pooling layer
+// fills in cells that fall outside the input when its span
+// doesn't evenly divide its input dimensions.
+type PadMode int
+
+const (
+	// PadNone disables padding. Input values in an
+	// "incomplete" pool are ignored, just as they always
+	// were before PadMode existed.
+	PadNone PadMode = iota
+
+	// PadZero pads out-of-bounds cells with zero.
+	PadZero
+
+	// PadNegInf pads out-of-bounds cells with negative
+	// infinity, guaranteeing that a padded cell can never win
+	// a max-pool's argmax.
+	PadNegInf
+
+	// PadReflect pads by reflecting the input across its
+	// border, rather than introducing a new value.
+	PadReflect
+
+	// PadSame ignores PadX/PadY and instead computes however
+	// much padding is needed so that the output's spatial
+	// dimensions equal ceil(input/stride), as in the "SAME"
+	// padding used by most other frameworks. Cells added by
+	// PadSame are filled as in PadNegInf.
+	PadSame
+)
+
 // MaxPool is a max-pooling layer.
 //
 // All input and output tensors are row-major depth-minor.
 //
 // If the span along a dimension doesn't divide the
-// corresponding input dimension, then any input values in
-// an "incomplete" pool are ignored.
+// corresponding input dimension and PadMode is PadNone,
+// then any input values in an "incomplete" pool are
+// ignored. Otherwise, PadMode and PadX/PadY control how the
+// input is padded before pooling; see the PadMode docs.
 type MaxPool struct {
 	// Span is equivalent to a convolutional layer's filter
 	// size.
@@ -36,22 +70,42 @@ type MaxPool struct {
 	InputHeight int
 	InputDepth  int
 
+	// PadX and PadY specify symmetric padding to apply to
+	// each side of the input in the respective dimension.
+	// They are ignored when PadMode is PadNone or PadSame.
+	PadX int
+	PadY int
+
+	// PadMode selects the padding behavior. See the PadMode
+	// docs for details. The zero value, PadNone, preserves
+	// the original VALID-only behavior.
+	PadMode PadMode
+
 	im2colLock sync.Mutex
 	im2col     anyvec.Mapper
+	padVec     anyvec.Vector
 }
 
 // DeserializeMaxPool deserializes a MaxPool.
 func DeserializeMaxPool(d []byte) (*MaxPool, error) {
-	var sX, sY, iW, iH, iD, strideX, strideY serializer.Int
-	err := serializer.DeserializeAny(d, &sX, &sY, &iW, &iH, &iD, &strideX, &strideY)
+	var sX, sY, iW, iH, iD, strideX, strideY, padX, padY, padMode serializer.Int
+	err := serializer.DeserializeAny(d, &sX, &sY, &iW, &iH, &iD, &strideX, &strideY,
+		&padX, &padY, &padMode)
 	if err != nil {
-		// Legacy format did not store strideX and strideY.
-		err = serializer.DeserializeAny(d, &sX, &sY, &iW, &iH, &iD)
+		// Legacy format did not store padding.
+		err = serializer.DeserializeAny(d, &sX, &sY, &iW, &iH, &iD, &strideX, &strideY)
 		if err != nil {
-			return nil, essentials.AddCtx("deserialize MaxPool", err)
+			// Legacy format did not store strideX and strideY.
+			err = serializer.DeserializeAny(d, &sX, &sY, &iW, &iH, &iD)
+			if err != nil {
+				return nil, essentials.AddCtx("deserialize MaxPool", err)
+			}
+			strideX = sX
+			strideY = sY
 		}
-		strideX = sX
-		strideY = sY
+		padX = 0
+		padY = 0
+		padMode = serializer.Int(PadNone)
 	}
 	return &MaxPool{
 		SpanX:       int(sX),
@@ -61,6 +115,9 @@ func DeserializeMaxPool(d []byte) (*MaxPool, error) {
 		InputWidth:  int(iW),
 		InputHeight: int(iH),
 		InputDepth:  int(iD),
+		PadX:        int(padX),
+		PadY:        int(padY),
+		PadMode:     PadMode(padMode),
 	}, nil
 }
 
@@ -98,6 +155,9 @@ func (m *MaxPool) Apply(in anydiff.Res, batchSize int) anydiff.Res {
 	var maxMaps []anyvec.Mapper
 	for i := 0; i < batchSize; i++ {
 		subIn := in.Output().Slice(imgSize*i, imgSize*(i+1))
+		if m.padVec != nil {
+			subIn = in.Output().Creator().Concat(subIn, m.padVec)
+		}
 		m.im2col.Map(subIn, im2ColTemp)
 		mapping := anyvec.MapMax(im2ColTemp, m.SpanX*m.SpanY)
 		output := in.Output().Creator().MakeVector(mapping.OutSize())
@@ -130,39 +190,133 @@ func (m *MaxPool) Serialize() ([]byte, error) {
 		serializer.Int(m.InputDepth),
 		serializer.Int(m.StrideX),
 		serializer.Int(m.StrideY),
+		serializer.Int(m.PadX),
+		serializer.Int(m.PadY),
+		serializer.Int(m.PadMode),
 	)
 }
 
 func (m *MaxPool) initIm2Col(cr anyvec.Creator) {
-	var mapping []int
+	mapping, inSize, usesSentinel, fillValue := m.mappingData()
+	if usesSentinel {
+		m.padVec = cr.MakeVectorData(cr.MakeNumericList([]float64{fillValue}))
+	}
+	m.im2col = cr.MakeMapper(inSize, mapping)
+}
+
+// mappingData computes the (possibly padded) im2col mapping
+// without requiring an anyvec.Creator, so it can be shared
+// between initIm2Col and code generation.
+func (m *MaxPool) mappingData() (mapping []int, inSize int, usesSentinel bool, fillValue float64) {
+	padLeft, padRight, padTop, padBottom := m.padAmounts()
+	paddedWidth := m.InputWidth + padLeft + padRight
+	paddedHeight := m.InputHeight + padTop + padBottom
+	usesSentinel = m.PadMode != PadNone && m.PadMode != PadReflect
 
-	for y := 0; y+m.SpanY <= m.InputHeight; y += m.StrideY {
-		for x := 0; x+m.SpanX <= m.InputWidth; x += m.StrideX {
+	sentinel := m.InputWidth * m.InputHeight * m.InputDepth
+
+	for y := 0; y+m.SpanY <= paddedHeight; y += m.StrideY {
+		for x := 0; x+m.SpanX <= paddedWidth; x += m.StrideX {
 			for subZ := 0; subZ < m.InputDepth; subZ++ {
 				for subY := 0; subY < m.SpanY; subY++ {
-					subYIdx := (y + subY) * m.InputWidth * m.InputDepth
+					realY := y + subY - padTop
 					for subX := 0; subX < m.SpanX; subX++ {
-						subXIdx := subYIdx + (subX+x)*m.InputDepth
-						mapping = append(mapping, subXIdx+subZ)
+						realX := x + subX - padLeft
+						mapping = append(mapping, m.sourceIndex(realY, realX, subZ, sentinel))
 					}
 				}
 			}
 		}
 	}
 
-	inSize := m.InputWidth * m.InputHeight * m.InputDepth
-	m.im2col = cr.MakeMapper(inSize, mapping)
+	inSize = sentinel
+	if usesSentinel {
+		inSize++
+		fillValue = m.padFillValue()
+	}
+	return
+}
+
+// sourceIndex returns the index, into the (possibly
+// sentinel-augmented) input vector, of the value that
+// should be read for the padded coordinate (realY, realX)
+// at depth subZ.
+func (m *MaxPool) sourceIndex(realY, realX, subZ, sentinel int) int {
+	if realY >= 0 && realY < m.InputHeight && realX >= 0 && realX < m.InputWidth {
+		return realY*m.InputWidth*m.InputDepth + realX*m.InputDepth + subZ
+	}
+	if m.PadMode == PadReflect {
+		realY = reflectIndex(realY, m.InputHeight)
+		realX = reflectIndex(realX, m.InputWidth)
+		return realY*m.InputWidth*m.InputDepth + realX*m.InputDepth + subZ
+	}
+	return sentinel
+}
+
+// padAmounts computes the padding to add to each side of
+// the input, based on PadMode, PadX, and PadY.
+func (m *MaxPool) padAmounts() (left, right, top, bottom int) {
+	switch m.PadMode {
+	case PadNone:
+		return 0, 0, 0, 0
+	case PadSame:
+		totalX := samePadTotal(m.InputWidth, m.SpanX, m.StrideX)
+		totalY := samePadTotal(m.InputHeight, m.SpanY, m.StrideY)
+		return totalX / 2, totalX - totalX/2, totalY / 2, totalY - totalY/2
+	default:
+		return m.PadX, m.PadX, m.PadY, m.PadY
+	}
+}
+
+// padFillValue returns the value used to fill sentinel
+// (out-of-bounds) cells, based on PadMode.
+func (m *MaxPool) padFillValue() float64 {
+	if m.PadMode == PadZero {
+		return 0
+	}
+	return math.Inf(-1)
+}
+
+// samePadTotal computes the total amount of padding needed
+// along one dimension so that the output size equals
+// ceil(inSize/stride), as in "SAME" padding.
+func samePadTotal(inSize, span, stride int) int {
+	outSize := (inSize + stride - 1) / stride
+	total := (outSize-1)*stride + span - inSize
+	if total < 0 {
+		return 0
+	}
+	return total
+}
+
+// reflectIndex maps an out-of-bounds index i into [0, n)
+// by reflecting it across the border, without repeating the
+// edge value (e.g. -1 maps to 1, not 0).
+func reflectIndex(i, n int) int {
+	if n == 1 {
+		return 0
+	}
+	period := 2 * (n - 1)
+	i %= period
+	if i < 0 {
+		i += period
+	}
+	if i >= n {
+		i = period - i
+	}
+	return i
 }
 
 func (m *MaxPool) surrogateConv() *Conv {
+	padLeft, padRight, padTop, padBottom := m.padAmounts()
 	return &Conv{
 		FilterCount:  m.InputDepth,
 		FilterWidth:  m.SpanX,
 		FilterHeight: m.SpanY,
 		StrideX:      m.StrideX,
 		StrideY:      m.StrideY,
-		InputWidth:   m.InputWidth,
-		InputHeight:  m.InputHeight,
+		InputWidth:   m.InputWidth + padLeft + padRight,
+		InputHeight:  m.InputHeight + padTop + padBottom,
 		InputDepth:   m.InputDepth,
 	}
 }
@@ -184,6 +338,7 @@ func (m *maxPoolRes) Vars() anydiff.VarSet {
 
 func (m *maxPoolRes) Propagate(u anyvec.Vector, g anydiff.Grad) {
 	outSize := u.Len() / len(m.Maps)
+	imgSize := m.Layer.InputWidth * m.Layer.InputHeight * m.Layer.InputDepth
 	var upPieces []anyvec.Vector
 	for i, mapper := range m.Maps {
 		upSlice := u.Slice(outSize*i, outSize*(i+1))
@@ -191,6 +346,12 @@ func (m *maxPoolRes) Propagate(u anyvec.Vector, g anydiff.Grad) {
 		mapper.MapTranspose(upSlice, permed)
 		upPiece := u.Creator().MakeVector(m.Layer.im2col.InSize())
 		m.Layer.im2col.MapTranspose(permed, upPiece)
+		if m.Layer.padVec != nil {
+			// Mask out the gradient that flowed to the
+			// sentinel padding cell; it has no real input to
+			// receive it.
+			upPiece = upPiece.Slice(0, imgSize)
+		}
 		upPieces = append(upPieces, upPiece)
 	}
 	upstream := u.Creator().Concat(upPieces...)
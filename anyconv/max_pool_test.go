@@ -0,0 +1,148 @@
+package anyconv
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// TestMaxPoolReflect checks PadReflect against hand-computed
+// values, since reflectIndex isn't exercised by the
+// non-reflect padding modes. InputHeight is 1, so the
+// single-cell-dimension case is hit; PadX is 1, so no index
+// is more than one period out of bounds.
+func TestMaxPoolReflect(t *testing.T) {
+	layer := &MaxPool{
+		SpanX:       3,
+		SpanY:       1,
+		StrideX:     1,
+		StrideY:     1,
+		InputWidth:  4,
+		InputHeight: 1,
+		InputDepth:  1,
+		PadX:        1,
+		PadY:        0,
+		PadMode:     PadReflect,
+	}
+
+	c := anyvec32.CurrentCreator()
+	in := c.MakeVectorData(c.MakeNumericList([]float64{1, 2, 3, 4}))
+
+	out := layer.Apply(anydiff.NewVar(in), 1).Output().Data().([]float32)
+
+	// Reflecting [1, 2, 3, 4] across its borders gives
+	// ... 2, [1, 2, 3, 4], 3 ... so the span-3 windows
+	// starting at each input position are:
+	//   [2, 1, 2] -> 2
+	//   [1, 2, 3] -> 3
+	//   [2, 3, 4] -> 4
+	//   [3, 4, 3] -> 4
+	expected := []float32{2, 3, 4, 4}
+	if len(out) != len(expected) {
+		t.Fatalf("expected %d outputs, got %d", len(expected), len(out))
+	}
+	for i, x := range expected {
+		if out[i] != x {
+			t.Errorf("output %d: expected %v got %v", i, x, out[i])
+		}
+	}
+}
+
+// TestMaxPoolZeroAndNegInf checks PadZero and PadNegInf
+// against hand-computed values. The input is all-negative so
+// a zero-filled sentinel can win the max, distinguishing
+// PadZero from PadNegInf (whose sentinel can never win).
+func TestMaxPoolZeroAndNegInf(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	in := c.MakeVectorData(c.MakeNumericList([]float64{-1, -2, -3, -4}))
+
+	zero := &MaxPool{
+		SpanX:       3,
+		SpanY:       1,
+		StrideX:     1,
+		StrideY:     1,
+		InputWidth:  4,
+		InputHeight: 1,
+		InputDepth:  1,
+		PadX:        1,
+		PadY:        0,
+		PadMode:     PadZero,
+	}
+	// Padded: 0, [-1, -2, -3, -4], 0
+	//   [0, -1, -2] -> 0
+	//   [-1, -2, -3] -> -1
+	//   [-2, -3, -4] -> -2
+	//   [-3, -4, 0] -> 0
+	zeroOut := zero.Apply(anydiff.NewVar(in), 1).Output().Data().([]float32)
+	zeroExpected := []float32{0, -1, -2, 0}
+	for i, x := range zeroExpected {
+		if zeroOut[i] != x {
+			t.Errorf("PadZero output %d: expected %v got %v", i, x, zeroOut[i])
+		}
+	}
+
+	negInf := &MaxPool{
+		SpanX:       3,
+		SpanY:       1,
+		StrideX:     1,
+		StrideY:     1,
+		InputWidth:  4,
+		InputHeight: 1,
+		InputDepth:  1,
+		PadX:        1,
+		PadY:        0,
+		PadMode:     PadNegInf,
+	}
+	// Padded: -Inf, [-1, -2, -3, -4], -Inf
+	//   [-Inf, -1, -2] -> -1
+	//   [-1, -2, -3] -> -1
+	//   [-2, -3, -4] -> -2
+	//   [-3, -4, -Inf] -> -3
+	negInfOut := negInf.Apply(anydiff.NewVar(in), 1).Output().Data().([]float32)
+	negInfExpected := []float32{-1, -1, -2, -3}
+	for i, x := range negInfExpected {
+		if negInfOut[i] != x {
+			t.Errorf("PadNegInf output %d: expected %v got %v", i, x, negInfOut[i])
+		}
+	}
+}
+
+// TestMaxPoolSame checks PadSame's asymmetric left/right
+// padding split: with 3 cells of total padding, the window
+// starting at the second output position only lines up with
+// the input's later values if left=1, right=2 (not the
+// other way around).
+func TestMaxPoolSame(t *testing.T) {
+	layer := &MaxPool{
+		SpanX:       4,
+		SpanY:       1,
+		StrideX:     2,
+		StrideY:     1,
+		InputWidth:  5,
+		InputHeight: 1,
+		InputDepth:  1,
+		PadMode:     PadSame,
+	}
+
+	c := anyvec32.CurrentCreator()
+	in := c.MakeVectorData(c.MakeNumericList([]float64{5, 1, 1, 1, 9}))
+
+	out := layer.Apply(anydiff.NewVar(in), 1).Output().Data().([]float32)
+
+	// samePadTotal(5, 4, 2) = 3, split as left=1, right=2, so
+	// padded is -Inf, [5, 1, 1, 1, 9], -Inf, -Inf and the
+	// span-4 stride-2 windows are:
+	//   [-Inf, 5, 1, 1] -> 5
+	//   [1, 1, 1, 9]    -> 9
+	//   [1, 9, -Inf, -Inf] -> 9
+	expected := []float32{5, 9, 9}
+	if len(out) != len(expected) {
+		t.Fatalf("expected %d outputs, got %d", len(expected), len(out))
+	}
+	for i, x := range expected {
+		if out[i] != x {
+			t.Errorf("output %d: expected %v got %v", i, x, out[i])
+		}
+	}
+}
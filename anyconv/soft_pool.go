@@ -0,0 +1,260 @@
+package anyconv
+
+import (
+	"sync"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	var s SoftPool
+	serializer.RegisterTypedDeserializer(s.SerializerType(), DeserializeSoftPool)
+}
+
+// SoftPool is a differentiable pooling layer, similar to
+// MaxPool, that computes a quiet-softmax-weighted average
+// over each pool window:
+//
+//	sum_i(x_i * exp(x_i)) / (1 + sum_j exp(x_j))
+//
+// Unlike MaxPool's argmax, this gives every cell in a window
+// a nonzero gradient, while still letting the layer output
+// something close to zero when no cell in the window is
+// salient (all its values are strongly negative), which a
+// plain average cannot do.
+type SoftPool struct {
+	// Span is equivalent to a convolutional layer's filter
+	// size.
+	SpanX int
+	SpanY int
+
+	// Stride is equivalent to a convolutional layer's
+	// stride.
+	StrideX int
+	StrideY int
+
+	InputWidth  int
+	InputHeight int
+	InputDepth  int
+
+	im2colLock sync.Mutex
+	im2col     anyvec.Mapper
+	sumMapper  anyvec.Mapper
+}
+
+// DeserializeSoftPool deserializes a SoftPool.
+func DeserializeSoftPool(d []byte) (*SoftPool, error) {
+	var sX, sY, iW, iH, iD, strideX, strideY serializer.Int
+	err := serializer.DeserializeAny(d, &sX, &sY, &iW, &iH, &iD, &strideX, &strideY)
+	if err != nil {
+		return nil, essentials.AddCtx("deserialize SoftPool", err)
+	}
+	return &SoftPool{
+		SpanX:       int(sX),
+		SpanY:       int(sY),
+		StrideX:     int(strideX),
+		StrideY:     int(strideY),
+		InputWidth:  int(iW),
+		InputHeight: int(iH),
+		InputDepth:  int(iD),
+	}, nil
+}
+
+// OutputWidth returns the width of the output tensor.
+func (s *SoftPool) OutputWidth() int {
+	return s.surrogateConv().OutputWidth()
+}
+
+// OutputHeight returns the height of the output tensor.
+func (s *SoftPool) OutputHeight() int {
+	return s.surrogateConv().OutputHeight()
+}
+
+// OutputDepth returns the depth of the output tensor.
+func (s *SoftPool) OutputDepth() int {
+	return s.InputDepth
+}
+
+// Apply applies the layer to an input tensor.
+func (s *SoftPool) Apply(in anydiff.Res, batchSize int) anydiff.Res {
+	s.im2colLock.Lock()
+	if s.im2col == nil {
+		s.initIm2Col(in.Output().Creator())
+	}
+	s.im2colLock.Unlock()
+
+	imgSize := s.InputWidth * s.InputHeight * s.InputDepth
+	if in.Output().Len() != batchSize*imgSize {
+		panic("incorrect input size")
+	}
+
+	cr := in.Output().Creator()
+	numGroups := s.sumMapper.InSize()
+
+	var outs []anyvec.Vector
+	var xs, exps, denoms []anyvec.Vector
+	for i := 0; i < batchSize; i++ {
+		subIn := in.Output().Slice(imgSize*i, imgSize*(i+1))
+		x := cr.MakeVector(s.im2col.OutSize())
+		s.im2col.Map(subIn, x)
+
+		exp := x.Copy()
+		anyvec.Exp(exp)
+
+		weighted := x.Copy()
+		weighted.Mul(exp)
+		numer := cr.MakeVector(numGroups)
+		s.sumMapper.MapTranspose(weighted, numer)
+
+		denom := cr.MakeVector(numGroups)
+		s.sumMapper.MapTranspose(exp, denom)
+		denom.AddScalar(cr.MakeNumeric(1))
+
+		numer.Div(denom)
+
+		xs = append(xs, x)
+		exps = append(exps, exp)
+		denoms = append(denoms, denom)
+		outs = append(outs, numer)
+	}
+
+	return &softPoolRes{
+		Layer:  s,
+		In:     in,
+		OutVec: cr.Concat(outs...),
+		Xs:     xs,
+		Exps:   exps,
+		Denoms: denoms,
+		Outs:   outs,
+	}
+}
+
+// SerializerType returns the unique ID used to serialize a
+// SoftPool with the serializer package.
+func (s *SoftPool) SerializerType() string {
+	return "github.com/unixpickle/anynet/anyconv.SoftPool"
+}
+
+// Serialize serializes the SoftPool.
+func (s *SoftPool) Serialize() ([]byte, error) {
+	return serializer.SerializeAny(
+		serializer.Int(s.SpanX),
+		serializer.Int(s.SpanY),
+		serializer.Int(s.InputWidth),
+		serializer.Int(s.InputHeight),
+		serializer.Int(s.InputDepth),
+		serializer.Int(s.StrideX),
+		serializer.Int(s.StrideY),
+	)
+}
+
+func (s *SoftPool) initIm2Col(cr anyvec.Creator) {
+	mapping, groupSize := s.mappingData()
+
+	inSize := s.InputWidth * s.InputHeight * s.InputDepth
+	s.im2col = cr.MakeMapper(inSize, mapping)
+
+	numGroups := len(mapping) / groupSize
+	groupMapping := make([]int, len(mapping))
+	for i := range groupMapping {
+		groupMapping[i] = i / groupSize
+	}
+	s.sumMapper = cr.MakeMapper(numGroups, groupMapping)
+}
+
+// mappingData computes the im2col mapping, shared with
+// AvgPool's layout (groups of SpanX*SpanY contiguous
+// elements, one group per (output position, depth) pair).
+func (s *SoftPool) mappingData() (mapping []int, groupSize int) {
+	groupSize = s.SpanX * s.SpanY
+
+	for y := 0; y+s.SpanY <= s.InputHeight; y += s.StrideY {
+		for x := 0; x+s.SpanX <= s.InputWidth; x += s.StrideX {
+			for subZ := 0; subZ < s.InputDepth; subZ++ {
+				for subY := 0; subY < s.SpanY; subY++ {
+					subYIdx := (y + subY) * s.InputWidth * s.InputDepth
+					for subX := 0; subX < s.SpanX; subX++ {
+						subXIdx := subYIdx + (subX+x)*s.InputDepth
+						mapping = append(mapping, subXIdx+subZ)
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+func (s *SoftPool) surrogateConv() *Conv {
+	return &Conv{
+		FilterCount:  s.InputDepth,
+		FilterWidth:  s.SpanX,
+		FilterHeight: s.SpanY,
+		StrideX:      s.StrideX,
+		StrideY:      s.StrideY,
+		InputWidth:   s.InputWidth,
+		InputHeight:  s.InputHeight,
+		InputDepth:   s.InputDepth,
+	}
+}
+
+type softPoolRes struct {
+	Layer  *SoftPool
+	In     anydiff.Res
+	OutVec anyvec.Vector
+
+	// Xs, Exps, Denoms, and Outs hold, per batch element, the
+	// im2col'd input, its elementwise exp, the per-window
+	// denominator (1 + sum of exp), and the layer's output,
+	// all needed to evaluate Propagate's Jacobian.
+	Xs     []anyvec.Vector
+	Exps   []anyvec.Vector
+	Denoms []anyvec.Vector
+	Outs   []anyvec.Vector
+}
+
+func (s *softPoolRes) Output() anyvec.Vector {
+	return s.OutVec
+}
+
+func (s *softPoolRes) Vars() anydiff.VarSet {
+	return s.In.Vars()
+}
+
+// Propagate implements d(out_g)/d(x_i) = exp(x_i)/denom_g *
+// (1 + x_i - out_g) for i in window g, as derived from the
+// quotient rule applied to out_g = numer_g/denom_g.
+func (s *softPoolRes) Propagate(u anyvec.Vector, g anydiff.Grad) {
+	cr := u.Creator()
+	groupSize := s.Layer.SpanX * s.Layer.SpanY
+	numGroups := s.Layer.sumMapper.InSize()
+
+	var upPieces []anyvec.Vector
+	for i := range s.Xs {
+		upSlice := u.Slice(numGroups*i, numGroups*(i+1))
+
+		outBroadcast := cr.MakeVector(groupSize * numGroups)
+		s.Layer.sumMapper.Map(s.Outs[i], outBroadcast)
+
+		denomBroadcast := cr.MakeVector(groupSize * numGroups)
+		s.Layer.sumMapper.Map(s.Denoms[i], denomBroadcast)
+
+		upBroadcast := cr.MakeVector(groupSize * numGroups)
+		s.Layer.sumMapper.Map(upSlice, upBroadcast)
+
+		coeff := s.Xs[i].Copy()
+		coeff.AddScalar(cr.MakeNumeric(1))
+		coeff.Sub(outBroadcast)
+		coeff.Mul(s.Exps[i])
+		coeff.Div(denomBroadcast)
+		coeff.Mul(upBroadcast)
+
+		upPiece := cr.MakeVector(s.Layer.im2col.InSize())
+		s.Layer.im2col.MapTranspose(coeff, upPiece)
+		upPieces = append(upPieces, upPiece)
+	}
+	upstream := cr.Concat(upPieces...)
+	s.In.Propagate(upstream, g)
+}
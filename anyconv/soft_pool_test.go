@@ -0,0 +1,40 @@
+package anyconv
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anydiff/anydifftest"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// TestSoftPoolPropagate finite-difference checks Propagate's
+// hand-derived quotient-rule Jacobian.
+func TestSoftPoolPropagate(t *testing.T) {
+	layer := &SoftPool{
+		SpanX:       2,
+		SpanY:       2,
+		StrideX:     2,
+		StrideY:     2,
+		InputWidth:  4,
+		InputHeight: 4,
+		InputDepth:  1,
+	}
+
+	c := anyvec32.CurrentCreator()
+	in := c.MakeVectorData(c.MakeNumericList([]float64{
+		0.3, -0.5, 1.2, 0.1,
+		-0.2, 0.4, 0.7, -1.1,
+		0.05, 0.9, -0.3, 0.6,
+		-0.8, 0.2, 1.5, -0.4,
+	}))
+	inVar := anydiff.NewVar(in)
+
+	checker := &anydifftest.ResChecker{
+		F: func() anydiff.Res {
+			return layer.Apply(inVar, 1)
+		},
+		V: []*anydiff.Var{inVar},
+	}
+	checker.FullCheck(t)
+}
@@ -0,0 +1,149 @@
+// Package anygen compiles anynet/anyrnn layer graphs into
+// standalone Go source that performs forward inference
+// without importing anydiff or anyvec, similar in spirit to
+// the NN-512 approach of compiling a network specification
+// into dependency-free C.
+//
+// A layer opts into code generation by implementing
+// Codegen. Composite layers (e.g. anyrnn.Stack) implement it
+// by emitting their children's code in turn, so a whole
+// graph can be compiled as long as every layer it uses
+// supports it. Layers that don't implement Codegen cause
+// Generate to fail with an error naming the unsupported
+// layer, rather than silently producing an incomplete file.
+//
+// As of this package's introduction, Codegen is only
+// implemented by anynet.QuietSoftmax, anyconv's MaxPool and
+// AvgPool, and anyrnn.Stack's plumbing. Weight-bearing layers
+// (anynet.Dense, anyconv.Conv, batch normalization, etc.)
+// don't implement it yet, nor do anyconv's other weightless
+// pooling layers (AdaptiveAvgPool2D, AdaptiveMaxPool2D,
+// SoftPool), so Generate can't yet compile a trained model,
+// or every weightless graph, end-to-end.
+//
+// This is an intentionally partial first increment: it lands
+// the Codegen interface, Ctx scaffolding, and Generate driver
+// that weight-bearing layers will plug into, without yet
+// implementing any of them. Compiling a trained model
+// end-to-end is left as follow-up work on top of this
+// package, not something this package claims to do yet.
+package anygen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// A Codegen is implemented by layers that can emit their
+// forward pass as literal Go source.
+type Codegen interface {
+	// EmitForward writes statements to ctx.Body that compute
+	// outVar from inVar, where both are []float32 locals in
+	// the function being generated. inVar is guaranteed to
+	// already be declared; EmitForward must declare outVar
+	// (e.g. via ":=").
+	//
+	// EmitForward may use ctx.TempVar to name any further
+	// intermediate variables it needs, ctx.ConstInts to fold
+	// constant data (im2col mappings, etc.) into the generated
+	// source, and ctx.AddImport to require a standard-library
+	// import.
+	EmitForward(ctx *Ctx, inVar, outVar string) error
+}
+
+// A Ctx tracks the state of an in-progress code generation.
+type Ctx struct {
+	// Consts accumulates package-level constant declarations
+	// (e.g. baked-in index mappings).
+	Consts bytes.Buffer
+
+	// Body accumulates the statements of the generated
+	// Infer function.
+	Body bytes.Buffer
+
+	varCount   int
+	constCount int
+	imports    map[string]bool
+}
+
+// AddImport records that the generated source needs to
+// import path (e.g. "math"). It is safe to call more than
+// once with the same path.
+func (c *Ctx) AddImport(path string) {
+	if c.imports == nil {
+		c.imports = map[string]bool{}
+	}
+	c.imports[path] = true
+}
+
+// TempVar returns a fresh, unused variable name for an
+// intermediate tensor.
+func (c *Ctx) TempVar() string {
+	c.varCount++
+	return fmt.Sprintf("t%d", c.varCount)
+}
+
+// ConstInts folds vals into the generated source as a
+// package-level []int slice, and returns its identifier.
+// It is meant for data-independent constants like im2col
+// mappings, which are the same for every forward pass.
+func (c *Ctx) ConstInts(vals []int) string {
+	name := fmt.Sprintf("table%d", c.nextConst())
+	fmt.Fprintf(&c.Consts, "var %s = []int{", name)
+	for i, v := range vals {
+		if i > 0 {
+			c.Consts.WriteString(", ")
+		}
+		fmt.Fprintf(&c.Consts, "%d", v)
+	}
+	c.Consts.WriteString("}\n")
+	return name
+}
+
+func (c *Ctx) nextConst() int {
+	c.constCount++
+	return c.constCount
+}
+
+// Generate walks model, asking it (and anything it delegates
+// to) to emit its forward pass, and assembles the result
+// into a self-contained Go source file in package pkg. The
+// file exposes a single function, Infer, that maps a
+// flattened input of length inputSize to a flattened output.
+//
+// Generate does not itself know how to emit any layer; it
+// only provides the scaffolding (package clause, imports,
+// constants, function signature) around whatever
+// model.EmitForward writes.
+func Generate(pkg string, model Codegen, inputSize int) ([]byte, error) {
+	ctx := &Ctx{}
+	if err := model.EmitForward(ctx, "input", "output"); err != nil {
+		return nil, fmt.Errorf("anygen: generate: %s", err)
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	if len(ctx.imports) > 0 {
+		var paths []string
+		for path := range ctx.imports {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		out.WriteString("import (\n")
+		for _, path := range paths {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(ctx.Consts.Bytes())
+	out.WriteString("\n// Infer runs the compiled model's forward pass on a\n" +
+		"// single, flattened input and returns a flattened output.\n" +
+		"// It has no dependency on anydiff or anyvec.\n")
+	out.WriteString("func Infer(input []float32) []float32 {\n")
+	fmt.Fprintf(&out, "\tif len(input) != %d {\n\t\tpanic(\"anygen: incorrect input size\")\n\t}\n",
+		inputSize)
+	out.Write(ctx.Body.Bytes())
+	out.WriteString("\treturn output\n}\n")
+	return out.Bytes(), nil
+}
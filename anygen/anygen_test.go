@@ -0,0 +1,115 @@
+package anygen
+
+import (
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// maxWithSentinel emits the same append(append([]float32{},
+// ...), float32(math.Inf(-1))) sentinel pattern that
+// anyconv.MaxPool's EmitForward uses for PadNegInf, so that
+// pattern (plus the math.Inf import it requires) is covered
+// even though anyconv itself can't be imported from this
+// test.
+type maxWithSentinel struct{}
+
+func (maxWithSentinel) EmitForward(ctx *Ctx, inVar, outVar string) error {
+	ctx.AddImport("math")
+	sentinel := ctx.TempVar()
+	ctx.Body.WriteString("\t" + sentinel + " := append(append([]float32{}, " + inVar +
+		"...), float32(math.Inf(-1)))\n")
+	ctx.Body.WriteString("\t" + outVar + " := []float32{" + sentinel + "[0]}\n")
+	ctx.Body.WriteString("\tfor _, v := range " + sentinel + " {\n")
+	ctx.Body.WriteString("\t\tif v > " + outVar + "[0] {\n")
+	ctx.Body.WriteString("\t\t\t" + outVar + "[0] = v\n\t\t}\n\t}\n")
+	return nil
+}
+
+// scaleTwo doubles its (single-element) input, so chaining it
+// after maxWithSentinel exercises Generate's handling of a
+// multi-layer graph and ctx.TempVar's fresh naming.
+type scaleTwo struct{}
+
+func (scaleTwo) EmitForward(ctx *Ctx, inVar, outVar string) error {
+	ctx.Body.WriteString("\t" + outVar + " := make([]float32, len(" + inVar + "))\n")
+	ctx.Body.WriteString("\tfor i, v := range " + inVar + " {\n")
+	ctx.Body.WriteString("\t\t" + outVar + "[i] = v * 2\n\t}\n")
+	return nil
+}
+
+type chain struct {
+	first, second Codegen
+}
+
+func (c chain) EmitForward(ctx *Ctx, inVar, outVar string) error {
+	mid := ctx.TempVar()
+	if err := c.first.EmitForward(ctx, inVar, mid); err != nil {
+		return err
+	}
+	return c.second.EmitForward(ctx, mid, outVar)
+}
+
+// TestGenerateValidGo checks that Generate's output parses
+// and can be gofmt'd as Go source, and that, when compiled
+// and run, it prints the hand-computed result.
+func TestGenerateValidGo(t *testing.T) {
+	model := chain{first: maxWithSentinel{}, second: scaleTwo{}}
+
+	src, err := Generate("compiled", model, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := parser.ParseFile(token.NewFileSet(), "compiled.go", src, 0); err != nil {
+		t.Fatalf("generated source does not parse: %v\n%s", err, src)
+	}
+	if _, err := format.Source(src); err != nil {
+		t.Fatalf("generated source cannot be gofmt'd: %v\n%s", err, src)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "compiled.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mainSrc := `package main
+
+import (
+	"fmt"
+
+	"anygentest/compiled"
+)
+
+func main() {
+	fmt.Println(compiled.Infer([]float32{1, 2, 3, -5})[0])
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(mainSrc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "compiled"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "compiled.go"), filepath.Join(dir, "compiled", "compiled.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module anygentest\n\ngo 1.18\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running generated code failed: %v\n%s", err, out)
+	}
+
+	// max(1, 2, 3, -5, -Inf) == 3, doubled is 6.
+	if got := string(out); got != "6\n" {
+		t.Fatalf("expected \"6\\n\", got %q", got)
+	}
+}
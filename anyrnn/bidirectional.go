@@ -0,0 +1,106 @@
+package anyrnn
+
+import (
+	"fmt"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anydiff/anyseq"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	var b Bidirectional
+	serializer.RegisterTypedDeserializer(b.SerializerType(), DeserializeBidirectional)
+}
+
+// Bidirectional runs two Blocks over a sequence: Forward
+// over the sequence as given, and Backward over the reversed
+// sequence. The two Blocks' per-timestep outputs are
+// concatenated to produce Bidirectional's output.
+//
+// Running Backward requires seeing an entire sequence before
+// producing its first (i.e. last-timestep) output, so
+// Bidirectional cannot be driven one timestep at a time.
+// It does not usefully implement the Block interface: Start,
+// PropagateStart, and Step all panic. Drive a Bidirectional
+// with Apply instead, on a complete anyseq.Seq. This also
+// means a Bidirectional cannot be used as a child of a Stack
+// that is itself driven with Step; it may still be composed
+// with other Blocks by calling Apply directly and feeding
+// the result into anyrnn.Map for the remainder of a model.
+type Bidirectional struct {
+	Forward  Block
+	Backward Block
+}
+
+// NewBidirectional creates a Bidirectional from its forward
+// and backward Blocks.
+func NewBidirectional(fwd, bwd Block) *Bidirectional {
+	return &Bidirectional{Forward: fwd, Backward: bwd}
+}
+
+// DeserializeBidirectional deserializes a Bidirectional.
+func DeserializeBidirectional(d []byte) (*Bidirectional, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, essentials.AddCtx("deserialize Bidirectional", err)
+	}
+	if len(slice) != 2 {
+		return nil, fmt.Errorf("deserialize Bidirectional: expected 2 fields, got %d", len(slice))
+	}
+	fwd, ok1 := slice[0].(Block)
+	bwd, ok2 := slice[1].(Block)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("deserialize Bidirectional: fields are not Blocks")
+	}
+	return &Bidirectional{Forward: fwd, Backward: bwd}, nil
+}
+
+// Apply runs the Bidirectional over an entire sequence,
+// concatenating the forward and backward outputs at each
+// timestep.
+func (b *Bidirectional) Apply(seq anyseq.Seq) anyseq.Seq {
+	fwdOut := Map(seq, b.Forward)
+	bwdOut := anyseq.Reverse(Map(anyseq.Reverse(seq), b.Backward))
+	return anyseq.MapN(func(n int, v []anydiff.Res) anydiff.Res {
+		return anydiff.Concat(v...)
+	}, fwdOut, bwdOut)
+}
+
+// Start panics. See the Bidirectional docs.
+func (b *Bidirectional) Start(n int) State {
+	panic("anyrnn: Bidirectional does not support Step; use Apply on a full anyseq.Seq")
+}
+
+// PropagateStart panics. See the Bidirectional docs.
+func (b *Bidirectional) PropagateStart(s StateGrad, g anydiff.Grad) {
+	panic("anyrnn: Bidirectional does not support Step; use Apply on a full anyseq.Seq")
+}
+
+// Step panics. See the Bidirectional docs.
+func (b *Bidirectional) Step(s State, in anyvec.Vector) Res {
+	panic("anyrnn: Bidirectional does not support Step; use Apply on a full anyseq.Seq")
+}
+
+// SerializerType returns the unique ID used to serialize a
+// Bidirectional with the serializer package.
+func (b *Bidirectional) SerializerType() string {
+	return "github.com/unixpickle/anynet/anyrnn.Bidirectional"
+}
+
+// Serialize serializes the Bidirectional.
+// It only works if both Forward and Backward are
+// serializer.Serializers.
+func (b *Bidirectional) Serialize() ([]byte, error) {
+	fwd, ok := b.Forward.(serializer.Serializer)
+	if !ok {
+		return nil, fmt.Errorf("serialize Bidirectional: Forward is not a serializer: %T", b.Forward)
+	}
+	bwd, ok := b.Backward.(serializer.Serializer)
+	if !ok {
+		return nil, fmt.Errorf("serialize Bidirectional: Backward is not a serializer: %T", b.Backward)
+	}
+	return serializer.SerializeSlice([]serializer.Serializer{fwd, bwd})
+}
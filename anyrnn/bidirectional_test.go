@@ -0,0 +1,196 @@
+package anyrnn
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anydiff/anyseq"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// negatingBlock is a stateless Block that negates its input,
+// used alongside doublingBlock (see residual_test.go) so the
+// forward and backward halves of a Bidirectional produce
+// distinguishable outputs.
+type negatingBlock struct{}
+
+func (negatingBlock) Start(n int) State                          { return dummyState{} }
+func (negatingBlock) PropagateStart(s StateGrad, g anydiff.Grad) {}
+
+func (negatingBlock) Step(s State, in anyvec.Vector) Res {
+	out := in.Copy()
+	out.Scale(out.Creator().MakeNumeric(-1))
+	return &negatingRes{OutVec: out, InState: s}
+}
+
+type negatingRes struct {
+	OutVec  anyvec.Vector
+	InState State
+}
+
+func (r *negatingRes) State() State          { return r.InState }
+func (r *negatingRes) Output() anyvec.Vector { return r.OutVec }
+func (r *negatingRes) Vars() anydiff.VarSet  { return anydiff.VarSet{} }
+
+func (r *negatingRes) Propagate(u anyvec.Vector, sg StateGrad,
+	g anydiff.Grad) (anyvec.Vector, StateGrad) {
+	down := u.Copy()
+	down.Scale(down.Creator().MakeNumeric(-1))
+	return down, sg
+}
+
+// litSeq is a leaf anyseq.Seq backed directly by a list of
+// *anydiff.Var, one per timestep, all present. It exists so
+// TestBidirectionalApplyGradient can seed Bidirectional.Apply
+// with a differentiable input without depending on whatever
+// constructor anyseq itself exposes for that purpose.
+type litSeq struct {
+	vars []*anydiff.Var
+}
+
+func (s *litSeq) Output() []*anyseq.Batch {
+	res := make([]*anyseq.Batch, len(s.vars))
+	present := make(anyseq.PresentMap, 1)
+	present[0] = true
+	for i, v := range s.vars {
+		res[i] = &anyseq.Batch{Present: present, Packed: v, Num: 1}
+	}
+	return res
+}
+
+func (s *litSeq) Vars() anydiff.VarSet {
+	res := anydiff.VarSet{}
+	for _, v := range s.vars {
+		res.Add(v)
+	}
+	return res
+}
+
+func (s *litSeq) Propagate(upstream []anyvec.Vector, g anydiff.Grad) {
+	for i, u := range upstream {
+		s.vars[i].Propagate(u, g)
+	}
+}
+
+// TestBidirectionalApplyOrdering checks that Apply pairs each
+// timestep's forward output with the *same* timestep's
+// backward output, i.e. that the backward half is correctly
+// re-reversed after running Backward over the reversed
+// sequence rather than left in reverse order.
+func TestBidirectionalApplyOrdering(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	b := NewBidirectional(doublingBlock{}, negatingBlock{})
+
+	values := []float64{0.5, -1.5, 2.0}
+	seq := constSeq(c, values)
+
+	out := b.Apply(seq).Output()
+	if len(out) != len(values) {
+		t.Fatalf("expected %d timesteps, got %d", len(values), len(out))
+	}
+	for i, x := range values {
+		got := out[i].Packed.Output().Data().([]float32)
+		want := []float64{2 * x, -x}
+		if len(got) != 2 || math.Abs(float64(got[0])-want[0]) > 1e-4 ||
+			math.Abs(float64(got[1])-want[1]) > 1e-4 {
+			t.Errorf("timestep %d: expected %v, got %v", i, want, got)
+		}
+	}
+}
+
+// TestBidirectionalApplyPresent exercises the variable-length
+// path by feeding sequences of different lengths through the
+// same batch, and checking that later timesteps' Present and
+// Num correctly drop the shorter sequence.
+func TestBidirectionalApplyPresent(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	b := NewBidirectional(doublingBlock{}, negatingBlock{})
+
+	seq := anyseq.ConstSeqList(c, [][]anyvec.Vector{
+		vectorList(c, []float64{1, 2, 3}),
+		vectorList(c, []float64{1, 2}),
+	})
+
+	out := b.Apply(seq).Output()
+	if len(out) != 3 {
+		t.Fatalf("expected 3 timesteps, got %d", len(out))
+	}
+	expectedNum := []int{2, 2, 1}
+	for i, n := range expectedNum {
+		if out[i].Num != n {
+			t.Errorf("timestep %d: expected Num %d, got %d", i, n, out[i].Num)
+		}
+	}
+	if out[2].Present[0] != true || out[2].Present[1] != false {
+		t.Errorf("timestep 2: expected only the longer sequence present, got %v", out[2].Present)
+	}
+}
+
+// TestBidirectionalApplyGradient finite-difference checks the
+// gradient of Apply, covering both the Forward path and the
+// Backward path (which flows through anyseq.Reverse twice).
+func TestBidirectionalApplyGradient(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	b := NewBidirectional(doublingBlock{}, negatingBlock{})
+
+	values := []float64{0.5, -1.5, 2.0}
+	upstream := [][]float64{{1, 0.5}, {-0.5, 1}, {0.25, -1}}
+
+	loss := func(xs []float64) float64 {
+		seq := constSeq(c, xs)
+		out := b.Apply(seq).Output()
+		var sum float64
+		for i, batch := range out {
+			sum += dot(batch.Packed.Output(), vectorFrom(c, upstream[i]))
+		}
+		return sum
+	}
+
+	vars := make([]*anydiff.Var, len(values))
+	for i, x := range values {
+		vars[i] = anydiff.NewVar(vectorFrom(c, []float64{x}))
+	}
+	seq := &litSeq{vars: vars}
+	outSeq := b.Apply(seq)
+
+	g := anydiff.Grad{}
+	for _, v := range vars {
+		g[v] = c.MakeVector(1)
+	}
+	upVecs := make([]anyvec.Vector, len(upstream))
+	for i, u := range upstream {
+		upVecs[i] = vectorFrom(c, u)
+	}
+	outSeq.Propagate(upVecs, g)
+
+	const eps = 1e-3
+	for i, x := range values {
+		plus := append([]float64{}, values...)
+		plus[i] = x + eps
+		minus := append([]float64{}, values...)
+		minus[i] = x - eps
+		numeric := (loss(plus) - loss(minus)) / (2 * eps)
+		analytic := float64(g[vars[i]].Data().([]float32)[0])
+		if math.Abs(analytic-numeric) > 1e-2 {
+			t.Errorf("timestep %d: analytic %v numeric %v", i, analytic, numeric)
+		}
+	}
+}
+
+func constSeq(c anyvec.Creator, values []float64) anyseq.Seq {
+	return anyseq.ConstSeqList(c, [][]anyvec.Vector{vectorList(c, values)})
+}
+
+func vectorList(c anyvec.Creator, values []float64) []anyvec.Vector {
+	res := make([]anyvec.Vector, len(values))
+	for i, x := range values {
+		res[i] = vectorFrom(c, []float64{x})
+	}
+	return res
+}
+
+func vectorFrom(c anyvec.Creator, values []float64) anyvec.Vector {
+	return c.MakeVectorData(c.MakeNumericList(values))
+}
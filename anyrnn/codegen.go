@@ -0,0 +1,38 @@
+package anyrnn
+
+import (
+	"fmt"
+
+	"github.com/unixpickle/anynet/anygen"
+)
+
+// EmitForward implements anygen.Codegen for a Stack whose
+// children are all stateless and themselves implement
+// anygen.Codegen, chaining their generated code together.
+//
+// EmitForward only checks that each child implements
+// anygen.Codegen; it emits no loop over timesteps and threads
+// no State through. Residual and Bidirectional do not
+// implement anygen.Codegen, so a Stack containing either of
+// them makes EmitForward return an error.
+func (s Stack) EmitForward(ctx *anygen.Ctx, inVar, outVar string) error {
+	s.assertNonEmpty()
+
+	cur := inVar
+	for i, b := range s {
+		cg, ok := b.(anygen.Codegen)
+		if !ok {
+			return fmt.Errorf("anyrnn: Stack.EmitForward: block %d (%T) does not support "+
+				"code generation", i, b)
+		}
+		next := outVar
+		if i < len(s)-1 {
+			next = ctx.TempVar()
+		}
+		if err := cg.EmitForward(ctx, cur, next); err != nil {
+			return err
+		}
+		cur = next
+	}
+	return nil
+}
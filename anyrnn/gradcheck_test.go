@@ -0,0 +1,67 @@
+package anyrnn
+
+import (
+	"math"
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+)
+
+// dummyState is a State/StateGrad that panics if its
+// PresentMap-related methods are ever called. It's only
+// meant to be threaded opaquely through Step/Propagate in
+// tests that don't exercise batching or variable-length
+// sequences.
+type dummyState struct{}
+
+func (dummyState) Present() PresentMap       { panic("anyrnn: dummyState.Present called") }
+func (dummyState) Reduce(p PresentMap) State { panic("anyrnn: dummyState.Reduce called") }
+func (dummyState) Expand(p PresentMap) StateGrad {
+	panic("anyrnn: dummyState.Expand called")
+}
+
+// checkStepGrad finite-difference checks block.Step's
+// Propagate against its Output, for the scalar loss
+// dot(Step(state, in).Output(), u).
+func checkStepGrad(t *testing.T, block Block, state State, in, u anyvec.Vector) {
+	t.Helper()
+
+	loss := func(x anyvec.Vector) float64 {
+		return dot(block.Step(state, x).Output(), u)
+	}
+
+	res := block.Step(state, in)
+	downVec, _ := res.Propagate(u.Copy(), nil, anydiff.Grad{})
+	analytic := downVec.Data().([]float32)
+
+	const eps = 1e-3
+	cr := in.Creator()
+	base := cr.Float64Slice(in.Data())
+	for i := range base {
+		orig := base[i]
+
+		base[i] = orig + eps
+		plus := loss(cr.MakeVectorData(cr.MakeNumericList(base)))
+
+		base[i] = orig - eps
+		minus := loss(cr.MakeVectorData(cr.MakeNumericList(base)))
+
+		base[i] = orig
+
+		numeric := (plus - minus) / (2 * eps)
+		if math.Abs(float64(analytic[i])-numeric) > 1e-2 {
+			t.Errorf("gradient %d: analytic %v numeric %v", i, analytic[i], numeric)
+		}
+	}
+}
+
+func dot(a, b anyvec.Vector) float64 {
+	ad := a.Creator().Float64Slice(a.Data())
+	bd := b.Creator().Float64Slice(b.Data())
+	var sum float64
+	for i := range ad {
+		sum += ad[i] * bd[i]
+	}
+	return sum
+}
@@ -0,0 +1,190 @@
+package anyrnn
+
+import (
+	"fmt"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anynet"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/essentials"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	var r Residual
+	serializer.RegisterTypedDeserializer(r.SerializerType(), DeserializeResidual)
+	var n noProjection
+	serializer.RegisterTypedDeserializer(n.SerializerType(), deserializeNoProjection)
+}
+
+// Residual wraps a Block, adding its input to its output at
+// every timestep.
+//
+// If Inner's output dimension doesn't match its input
+// dimension, a linear projection is applied to the input
+// before adding it to Inner's output. The projection's
+// parameters are created up front by NewResidual, so they
+// are always included in Parameters(), even before the
+// first Step.
+type Residual struct {
+	Inner Block
+
+	Projection *anynet.Dense
+}
+
+// NewResidual wraps inner in a Residual. inSize and outSize
+// are Inner's input and output dimensions; if they differ,
+// the projection is created immediately using c.
+func NewResidual(c anyvec.Creator, inSize, outSize int, inner Block) *Residual {
+	r := &Residual{Inner: inner}
+	if inSize != outSize {
+		r.Projection = anynet.NewDense(c, inSize, outSize)
+	}
+	return r
+}
+
+// DeserializeResidual deserializes a Residual.
+func DeserializeResidual(d []byte) (*Residual, error) {
+	slice, err := serializer.DeserializeSlice(d)
+	if err != nil {
+		return nil, essentials.AddCtx("deserialize Residual", err)
+	}
+	if len(slice) != 2 {
+		return nil, fmt.Errorf("deserialize Residual: expected 2 fields, got %d", len(slice))
+	}
+	block, ok := slice[0].(Block)
+	if !ok {
+		return nil, fmt.Errorf("deserialize Residual: Inner is not a Block: %T", slice[0])
+	}
+	res := &Residual{Inner: block}
+	if dense, ok := slice[1].(*anynet.Dense); ok {
+		res.Projection = dense
+	}
+	return res, nil
+}
+
+// Parameters returns the parameters of Inner, provided it
+// implements anynet.Parameterizer, and of the projection, if
+// there is one.
+func (r *Residual) Parameters() []*anydiff.Var {
+	var res []*anydiff.Var
+	if p, ok := r.Inner.(anynet.Parameterizer); ok {
+		res = append(res, p.Parameters()...)
+	}
+	if r.Projection != nil {
+		res = append(res, r.Projection.Parameters()...)
+	}
+	return res
+}
+
+// Start produces a start State for Inner.
+func (r *Residual) Start(n int) State {
+	return r.Inner.Start(n)
+}
+
+// PropagateStart back-propagates through Inner's start
+// state.
+func (r *Residual) PropagateStart(s StateGrad, g anydiff.Grad) {
+	r.Inner.PropagateStart(s, g)
+}
+
+// Step applies the layer for a single timestep, adding in to
+// Inner's output (through a projection, if necessary).
+func (r *Residual) Step(s State, in anyvec.Vector) Res {
+	innerRes := r.Inner.Step(s, in)
+	outLen := innerRes.Output().Len()
+
+	out := innerRes.Output().Copy()
+
+	rr := &residualRes{Layer: r, Inner: innerRes}
+	if in.Len() == outLen {
+		out.Add(in)
+	} else {
+		if r.Projection == nil {
+			panic("anyrnn: Residual.Step: size mismatch with no projection")
+		}
+		rr.SkipVar = anydiff.NewVar(in)
+		rr.SkipRes = r.Projection.Apply(rr.SkipVar, 1)
+		out.Add(rr.SkipRes.Output())
+	}
+	rr.OutVec = out
+
+	return rr
+}
+
+// SerializerType returns the unique ID used to serialize a
+// Residual with the serializer package.
+func (r *Residual) SerializerType() string {
+	return "github.com/unixpickle/anynet/anyrnn.Residual"
+}
+
+// Serialize serializes the Residual.
+// It only works if Inner is a serializer.Serializer.
+func (r *Residual) Serialize() ([]byte, error) {
+	inner, ok := r.Inner.(serializer.Serializer)
+	if !ok {
+		return nil, fmt.Errorf("serialize Residual: Inner is not a serializer: %T", r.Inner)
+	}
+	var proj serializer.Serializer = r.Projection
+	if r.Projection == nil {
+		proj = noProjection{}
+	}
+	return serializer.SerializeSlice([]serializer.Serializer{inner, proj})
+}
+
+// noProjection is serialized in place of Residual.Projection
+// when the Residual has no projection.
+type noProjection struct{}
+
+func deserializeNoProjection(d []byte) (noProjection, error) {
+	return noProjection{}, nil
+}
+
+func (n noProjection) SerializerType() string {
+	return "github.com/unixpickle/anynet/anyrnn.noProjection"
+}
+
+func (n noProjection) Serialize() ([]byte, error) {
+	return nil, nil
+}
+
+type residualRes struct {
+	Layer  *Residual
+	Inner  Res
+	OutVec anyvec.Vector
+
+	// SkipVar and SkipRes are only set when a projection was
+	// used; otherwise the skip connection is the identity.
+	SkipVar *anydiff.Var
+	SkipRes anydiff.Res
+}
+
+func (r *residualRes) State() State {
+	return r.Inner.State()
+}
+
+func (r *residualRes) Output() anyvec.Vector {
+	return r.OutVec
+}
+
+func (r *residualRes) Vars() anydiff.VarSet {
+	v := r.Inner.Vars()
+	if r.SkipRes != nil {
+		v = anydiff.MergeVarSets(v, r.SkipRes.Vars())
+	}
+	return v
+}
+
+func (r *residualRes) Propagate(u anyvec.Vector, sg StateGrad, g anydiff.Grad) (anyvec.Vector,
+	StateGrad) {
+	downInner, downState := r.Inner.Propagate(u, sg, g)
+	if r.SkipRes == nil {
+		downInner.Add(u)
+		return downInner, downState
+	}
+	g[r.SkipVar] = r.SkipVar.Output().Creator().MakeVector(r.SkipVar.Output().Len())
+	r.SkipRes.Propagate(u, g)
+	downInner.Add(g[r.SkipVar])
+	delete(g, r.SkipVar)
+	return downInner, downState
+}
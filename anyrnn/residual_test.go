@@ -0,0 +1,104 @@
+package anyrnn
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// doublingBlock is a stateless Block that doubles its input,
+// used to exercise Residual's identity (matched-size) path.
+type doublingBlock struct{}
+
+func (doublingBlock) Start(n int) State                          { return dummyState{} }
+func (doublingBlock) PropagateStart(s StateGrad, g anydiff.Grad) {}
+
+func (doublingBlock) Step(s State, in anyvec.Vector) Res {
+	out := in.Copy()
+	out.Scale(out.Creator().MakeNumeric(2))
+	return &doublingRes{OutVec: out, InState: s}
+}
+
+type doublingRes struct {
+	OutVec  anyvec.Vector
+	InState State
+}
+
+func (r *doublingRes) State() State          { return r.InState }
+func (r *doublingRes) Output() anyvec.Vector { return r.OutVec }
+func (r *doublingRes) Vars() anydiff.VarSet  { return anydiff.VarSet{} }
+
+func (r *doublingRes) Propagate(u anyvec.Vector, sg StateGrad,
+	g anydiff.Grad) (anyvec.Vector, StateGrad) {
+	down := u.Copy()
+	down.Scale(down.Creator().MakeNumeric(2))
+	return down, sg
+}
+
+// truncatingBlock is a stateless Block that drops its input
+// down to its first Out components, used to exercise
+// Residual's projected (size-mismatch) path.
+type truncatingBlock struct {
+	Out int
+}
+
+func (b truncatingBlock) Start(n int) State                          { return dummyState{} }
+func (b truncatingBlock) PropagateStart(s StateGrad, g anydiff.Grad) {}
+
+func (b truncatingBlock) Step(s State, in anyvec.Vector) Res {
+	return &truncatingRes{
+		OutVec:  in.Slice(0, b.Out).Copy(),
+		InLen:   in.Len(),
+		InState: s,
+	}
+}
+
+type truncatingRes struct {
+	OutVec  anyvec.Vector
+	InLen   int
+	InState State
+}
+
+func (r *truncatingRes) State() State          { return r.InState }
+func (r *truncatingRes) Output() anyvec.Vector { return r.OutVec }
+func (r *truncatingRes) Vars() anydiff.VarSet  { return anydiff.VarSet{} }
+
+func (r *truncatingRes) Propagate(u anyvec.Vector, sg StateGrad,
+	g anydiff.Grad) (anyvec.Vector, StateGrad) {
+	pad := u.Creator().MakeVector(r.InLen - u.Len())
+	return u.Creator().Concat(u, pad), sg
+}
+
+// TestResidualStepIdentity gradient-checks Residual.Step
+// along the matched-size path, where the skip connection is
+// added directly (residualRes.Propagate's downInner.Add(u)
+// branch) rather than through a projection.
+func TestResidualStepIdentity(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	r := NewResidual(c, 3, 3, doublingBlock{})
+
+	in := c.MakeVectorData(c.MakeNumericList([]float64{0.3, -0.7, 1.4}))
+	u := c.MakeVectorData(c.MakeNumericList([]float64{1, -0.5, 0.25}))
+
+	checkStepGrad(t, r, r.Start(1), in, u)
+}
+
+// TestResidualStepProjected gradient-checks Residual.Step
+// along the size-mismatch path, where the skip connection
+// goes through Projection and residualRes.Propagate must
+// route gradient through SkipRes via g[r.SkipVar].
+func TestResidualStepProjected(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	r := NewResidual(c, 3, 2, truncatingBlock{Out: 2})
+
+	if r.Projection == nil {
+		t.Fatal("expected NewResidual to create a projection eagerly")
+	}
+
+	in := c.MakeVectorData(c.MakeNumericList([]float64{0.3, -0.7, 1.4}))
+	u := c.MakeVectorData(c.MakeNumericList([]float64{1, -0.5}))
+
+	checkStepGrad(t, r, r.Start(1), in, u)
+}
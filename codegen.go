@@ -0,0 +1,29 @@
+package anynet
+
+import (
+	"fmt"
+
+	"github.com/unixpickle/anynet/anygen"
+)
+
+// EmitForward implements anygen.Codegen.
+//
+// QuietSoftmax has no learned parameters, so there is
+// nothing to fold into the generated source besides the
+// arithmetic itself. The generated code assumes a single row
+// (i.e. as if Apply were called with n=1), which always holds
+// for the one flattened example anygen.Generate compiles
+// inference for.
+func (q *QuietSoftmax) EmitForward(ctx *anygen.Ctx, inVar, outVar string) error {
+	ctx.AddImport("math")
+	sumVar := ctx.TempVar()
+
+	fmt.Fprintf(&ctx.Body, "\t%s := make([]float32, len(%s))\n", outVar, inVar)
+	fmt.Fprintf(&ctx.Body, "\tvar %s float32\n", sumVar)
+	fmt.Fprintf(&ctx.Body, "\tfor i, x := range %s {\n", inVar)
+	fmt.Fprintf(&ctx.Body, "\t\t%s[i] = float32(math.Exp(float64(x)))\n", outVar)
+	fmt.Fprintf(&ctx.Body, "\t\t%s += %s[i]\n\t}\n", sumVar, outVar)
+	fmt.Fprintf(&ctx.Body, "\t%s++\n", sumVar)
+	fmt.Fprintf(&ctx.Body, "\tfor i := range %s {\n\t\t%s[i] /= %s\n\t}\n", outVar, outVar, sumVar)
+	return nil
+}
@@ -0,0 +1,113 @@
+package anynet
+
+import (
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anyvec"
+	"github.com/unixpickle/serializer"
+)
+
+func init() {
+	var q QuietSoftmax
+	serializer.RegisterTypedDeserializer(q.SerializerType(), DeserializeQuietSoftmax)
+}
+
+// QuietSoftmax is an activation layer that behaves like a
+// softmax, but with an extra implicit zero-logit term in the
+// denominator:
+//
+//	y_i = exp(x_i) / (1 + sum_j exp(x_j))
+//
+// This lets the layer output a near-zero distribution when
+// none of its inputs are salient (e.g. all strongly
+// negative), which an ordinary softmax cannot do since its
+// outputs always sum to one.
+//
+// QuietSoftmax operates row-wise: the input is split into n
+// equal chunks (one per batch element), and the above is
+// computed independently within each chunk.
+type QuietSoftmax struct{}
+
+// DeserializeQuietSoftmax deserializes a QuietSoftmax.
+func DeserializeQuietSoftmax(d []byte) (*QuietSoftmax, error) {
+	return &QuietSoftmax{}, nil
+}
+
+// Apply applies the layer to an input tensor.
+func (q *QuietSoftmax) Apply(in anydiff.Res, n int) anydiff.Res {
+	size := in.Output().Len() / n
+	mapper := quietRowMapper(in.Output().Creator(), n, size)
+
+	expVec := in.Output().Copy()
+	anyvec.Exp(expVec)
+
+	denoms := in.Output().Creator().MakeVector(n)
+	mapper.MapTranspose(expVec, denoms)
+	denoms.AddScalar(in.Output().Creator().MakeNumeric(1))
+
+	denomBroadcast := in.Output().Creator().MakeVector(n * size)
+	mapper.Map(denoms, denomBroadcast)
+
+	out := expVec.Copy()
+	out.Div(denomBroadcast)
+
+	return &quietSoftmaxRes{In: in, OutVec: out, Mapper: mapper}
+}
+
+// SerializerType returns the unique ID used to serialize a
+// QuietSoftmax with the serializer package.
+func (q *QuietSoftmax) SerializerType() string {
+	return "github.com/unixpickle/anynet.QuietSoftmax"
+}
+
+// Serialize serializes the QuietSoftmax.
+func (q *QuietSoftmax) Serialize() ([]byte, error) {
+	return []byte{}, nil
+}
+
+// quietRowMapper builds a Mapper that sums (via
+// MapTranspose) or broadcasts (via Map) a per-row value
+// across the size contiguous elements of each of n rows,
+// the same grouping trick used by anyconv's pooling layers.
+func quietRowMapper(cr anyvec.Creator, n, size int) anyvec.Mapper {
+	mapping := make([]int, n*size)
+	for i := range mapping {
+		mapping[i] = i / size
+	}
+	return cr.MakeMapper(n, mapping)
+}
+
+type quietSoftmaxRes struct {
+	In     anydiff.Res
+	OutVec anyvec.Vector
+	Mapper anyvec.Mapper
+}
+
+func (q *quietSoftmaxRes) Output() anyvec.Vector {
+	return q.OutVec
+}
+
+func (q *quietSoftmaxRes) Vars() anydiff.VarSet {
+	return q.In.Vars()
+}
+
+// Propagate uses the standard softmax Jacobian, since the
+// constant "+1" in the denominator is baked into OutVec and
+// cancels out of the derivative just as it does for an
+// ordinary softmax: d(y_i)/d(x_k) = y_i*(delta_ik - y_k).
+func (q *quietSoftmaxRes) Propagate(u anyvec.Vector, g anydiff.Grad) {
+	weighted := q.OutVec.Copy()
+	weighted.Mul(u)
+
+	n := q.Mapper.InSize()
+	dot := u.Creator().MakeVector(n)
+	q.Mapper.MapTranspose(weighted, dot)
+
+	dotBroadcast := u.Creator().MakeVector(q.Mapper.OutSize())
+	q.Mapper.Map(dot, dotBroadcast)
+
+	downstream := u.Copy()
+	downstream.Sub(dotBroadcast)
+	downstream.Mul(q.OutVec)
+
+	q.In.Propagate(downstream, g)
+}
@@ -0,0 +1,26 @@
+package anynet
+
+import (
+	"testing"
+
+	"github.com/unixpickle/anydiff"
+	"github.com/unixpickle/anydiff/anydifftest"
+	"github.com/unixpickle/anyvec/anyvec32"
+)
+
+// TestQuietSoftmaxPropagate finite-difference checks
+// Propagate's softmax-like Jacobian.
+func TestQuietSoftmaxPropagate(t *testing.T) {
+	c := anyvec32.CurrentCreator()
+	in := c.MakeVectorData(c.MakeNumericList([]float64{0.5, -1.2, 2.1, 0.3, -0.7, 1.0}))
+	inVar := anydiff.NewVar(in)
+
+	layer := &QuietSoftmax{}
+	checker := &anydifftest.ResChecker{
+		F: func() anydiff.Res {
+			return layer.Apply(inVar, 2)
+		},
+		V: []*anydiff.Var{inVar},
+	}
+	checker.FullCheck(t)
+}